@@ -15,6 +15,10 @@ import (
 
 const defaultServiceName = "mongodb"
 
+// analyticsIntegrationName is the integration identifier used to look up
+// DD_TRACE_MONGO_ANALYTICS_ENABLED.
+const analyticsIntegrationName = "MONGO"
+
 type mongoConfig struct {
 	ctx           context.Context
 	serviceName   string
@@ -23,19 +27,14 @@ type mongoConfig struct {
 }
 
 func newConfig() *mongoConfig {
-	rate := math.NaN()
-	if internal.BoolEnv("DD_TRACE_GIN_ANALYTICS_ENABLED", false) {
-		rate = 1.0
-	}
 	return &mongoConfig{
 		serviceName: namingschema.NewDefaultServiceName(
 			defaultServiceName,
 			namingschema.WithOverrideV0(defaultServiceName),
 		).GetName(),
-		spanName: namingschema.NewMongoDBOutboundOp().GetName(),
-		ctx:      context.Background(),
-		// analyticsRate: globalconfig.AnalyticsRate(),
-		analyticsRate: rate,
+		spanName:      namingschema.NewMongoDBOutboundOp().GetName(),
+		ctx:           context.Background(),
+		analyticsRate: internal.AnalyticsRateFromEnv(analyticsIntegrationName),
 	}
 }
 
@@ -0,0 +1,50 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package mgo
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyticsSettings(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		cfg := newConfig()
+		assert.True(t, math.IsNaN(cfg.analyticsRate))
+	})
+
+	t.Run("own-env-var", func(t *testing.T) {
+		t.Setenv("DD_TRACE_MONGO_ANALYTICS_ENABLED", "true")
+		cfg := newConfig()
+		assert.Equal(t, 1.0, cfg.analyticsRate)
+	})
+
+	t.Run("ignores-gin-env-var", func(t *testing.T) {
+		t.Setenv("DD_TRACE_GIN_ANALYTICS_ENABLED", "true")
+		cfg := newConfig()
+		assert.True(t, math.IsNaN(cfg.analyticsRate))
+	})
+
+	t.Run("with-analytics", func(t *testing.T) {
+		cfg := newConfig()
+		WithAnalytics(true)(cfg)
+		assert.Equal(t, 1.0, cfg.analyticsRate)
+
+		WithAnalytics(false)(cfg)
+		assert.True(t, math.IsNaN(cfg.analyticsRate))
+	})
+
+	t.Run("with-analytics-rate", func(t *testing.T) {
+		cfg := newConfig()
+		WithAnalyticsRate(0.5)(cfg)
+		assert.Equal(t, 0.5, cfg.analyticsRate)
+
+		WithAnalyticsRate(1.5)(cfg)
+		assert.True(t, math.IsNaN(cfg.analyticsRate))
+	})
+}
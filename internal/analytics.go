@@ -0,0 +1,28 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package internal
+
+import (
+	"fmt"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
+)
+
+// AnalyticsRateFromEnv returns the Trace Analytics sampling rate an
+// integration should start with: 1.0 when its own
+// DD_TRACE_<integrationName>_ANALYTICS_ENABLED env var is set to true, and
+// the globally configured globalconfig.AnalyticsRate() otherwise.
+//
+// integrationName is the upper-case identifier used in the env var name,
+// eg. "MONGO" for DD_TRACE_MONGO_ANALYTICS_ENABLED.
+func AnalyticsRateFromEnv(integrationName string) float64 {
+	rate := globalconfig.AnalyticsRate()
+	envVar := fmt.Sprintf("DD_TRACE_%s_ANALYTICS_ENABLED", integrationName)
+	if BoolEnv(envVar, false) {
+		rate = 1.0
+	}
+	return rate
+}
@@ -16,8 +16,6 @@ import (
 
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/remoteconfig"
-
-	rules "github.com/DataDog/appsec-internal-go/appsec"
 )
 
 const (
@@ -44,6 +42,17 @@ type Config struct {
 	// rules loaded via the env var DD_APPSEC_RULES. When not set, the builtin rules will be used
 	// and live-updated with remote configuration.
 	rulesManager *rulesManager
+	// ruleSources are the programmatic rule sources registered through
+	// WithRules, WithRuleSource, WithRulesFromFile and WithRulesFromURL, in
+	// registration order. They are merged into rulesManager by newConfig.
+	ruleSources []ruleSource
+	// localRuleWatchInterval is the polling interval set through
+	// WithLocalRuleWatch, used when filesystem notifications are unavailable. Zero disables hot-reloading of the local rules
+	// file referenced by DD_APPSEC_RULES.
+	localRuleWatchInterval time.Duration
+	// stopLocalRuleWatch stops the goroutine started for
+	// localRuleWatchInterval, if any. Nil when hot-reloading is disabled.
+	stopLocalRuleWatch func()
 	// Maximum WAF execution time
 	wafTimeout time.Duration
 	// AppSec trace rate limit (traces per second).
@@ -81,23 +90,49 @@ func isEnabled() (enabled bool, set bool, err error) {
 	return enabled, set, nil
 }
 
-func newConfig() (*Config, error) {
-	rules, err := readRulesConfig()
+func newConfig(opts ...StartOption) (*Config, error) {
+	c := &Config{
+		wafTimeout:     readWAFTimeoutConfig(),
+		traceRateLimit: readRateLimitConfig(),
+		obfuscator:     readObfuscatorConfig(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	rawRules, err := readRulesConfig(c.ruleSources)
 	if err != nil {
 		return nil, err
 	}
 
-	r, err := newRulesManager(rules)
+	r, err := newRulesManager(rawRules)
 	if err != nil {
 		return nil, err
 	}
+	c.rulesManager = r
 
-	return &Config{
-		rulesManager:   r,
-		wafTimeout:     readWAFTimeoutConfig(),
-		traceRateLimit: readRateLimitConfig(),
-		obfuscator:     readObfuscatorConfig(),
-	}, nil
+	if path := os.Getenv(rulesEnvVar); path != "" && c.localRuleWatchInterval > 0 {
+		c.stopLocalRuleWatch = startLocalRuleWatch(c.rulesManager, path, c.ruleSources, c.localRuleWatchInterval)
+	}
+
+	return c, nil
+}
+
+// Rules exposes the resolved WAF rule payload this Config was started or
+// last hot-reloaded with, so that callers can inspect which rules actually
+// ended up being loaded once every configured rule source has been merged.
+func (c *Config) Rules() []byte {
+	return c.rulesManager.Raw()
+}
+
+// Close releases the background resources started for this configuration,
+// such as the local rule file watcher enabled through WithLocalRuleWatch.
+// It must be called when AppSec stops so that repeated Start/Stop cycles,
+// eg. in tests, don't leak watch goroutines.
+func (c *Config) Close() {
+	if c.stopLocalRuleWatch != nil {
+		c.stopLocalRuleWatch()
+	}
 }
 
 func readWAFTimeoutConfig() (timeout time.Duration) {
@@ -164,23 +199,6 @@ func readObfuscatorConfigRegexp(name, defaultValue string) string {
 	return val
 }
 
-func readRulesConfig() ([]byte, error) {
-	filepath := os.Getenv(rulesEnvVar)
-	if filepath == "" {
-		log.Debug("appsec: using the default built-in recommended security rules")
-		return []byte(rules.StaticRecommendedRules), nil
-	}
-	buf, err := os.ReadFile(filepath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			log.Error("appsec: could not find the rules file in path %s: %v.", filepath, err)
-		}
-		return nil, err
-	}
-	log.Debug("appsec: using the security rules from file %s", filepath)
-	return buf, nil
-}
-
 func logEnvVarParsingError(name, value string, err error, defaultValue interface{}) {
 	log.Error("appsec: could not parse the env var %s=%s as a duration: %v. Using default value %v.", name, value, err, defaultValue)
 }
@@ -0,0 +1,32 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package appsec
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigRules(t *testing.T) {
+	c, err := newConfig(WithRules([]byte(`{"rules":[{"id":"custom","name":"from-memory"}]}`)))
+	require.NoError(t, err)
+
+	var doc struct {
+		Rules []map[string]interface{} `json:"rules"`
+	}
+	require.NoError(t, json.Unmarshal(c.Rules(), &doc))
+
+	found := false
+	for _, r := range doc.Rules {
+		if r["id"] == "custom" {
+			found = true
+		}
+	}
+	assert.True(t, found, "expected Rules() to expose the merged rule set")
+}
@@ -0,0 +1,79 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package appsec
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+// RuleFormat lowers a non-native rule definition into the JSON rule payload
+// the underlying WAF understands, so that rulesets authored in other rule
+// languages can be merged alongside native WAF rules.
+type RuleFormat interface {
+	// Name identifies the format, eg. "modsecurity". It is the key the
+	// format is registered and looked up under, and it appears in log
+	// messages.
+	Name() string
+	// Compile translates src into the WAF's native JSON rule payload.
+	Compile(src []byte) ([]byte, error)
+}
+
+// ruleFormats holds every registered RuleFormat, keyed by its Name().
+var ruleFormats = map[string]RuleFormat{}
+
+// RegisterRuleFormat registers f under f.Name(), replacing any format
+// already registered under that name. Detection only ever selects the
+// "modsecurity" format (by the .conf/.seclang extensions or SecRule
+// content), so a format registered under another name is not used to
+// compile any rule source.
+func RegisterRuleFormat(f RuleFormat) {
+	ruleFormats[f.Name()] = f
+}
+
+func init() {
+	RegisterRuleFormat(modSecurityRuleFormat{})
+}
+
+// ruleFormatExtensions maps file extensions to the name of the RuleFormat
+// that can compile them.
+var ruleFormatExtensions = map[string]string{
+	".conf":    "modsecurity",
+	".seclang": "modsecurity",
+}
+
+// detectRuleFormat returns the RuleFormat that can compile src, identified
+// by name's extension or, failing that, by sniffing src for magic bytes.
+// It returns nil when src already looks like a native WAF JSON rule payload.
+func detectRuleFormat(name string, src []byte) RuleFormat {
+	if formatName, ok := ruleFormatExtensions[strings.ToLower(filepath.Ext(name))]; ok {
+		return ruleFormats[formatName]
+	}
+
+	trimmed := bytes.TrimSpace(src)
+	if len(trimmed) == 0 || trimmed[0] == '{' || trimmed[0] == '[' {
+		return nil
+	}
+	if bytes.Contains(trimmed, []byte("SecRule")) {
+		return ruleFormats["modsecurity"]
+	}
+	return nil
+}
+
+// compileIfNeeded detects the rule format of src, named name, and compiles
+// it to the WAF's native JSON rule payload. src is returned unchanged when
+// it is not recognized as a non-native format.
+func compileIfNeeded(name string, src []byte) ([]byte, error) {
+	format := detectRuleFormat(name, src)
+	if format == nil {
+		return src, nil
+	}
+	log.Debug("appsec: compiling rules from %s using the %s rule format", name, format.Name())
+	return format.Compile(src)
+}
@@ -0,0 +1,184 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package appsec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+// modSecurityRuleFormat lowers a useful subset of ModSecurity/SecLang
+// SecRule directives into the WAF's native JSON rule format, namely the
+// common shape `SecRule TARGETS "OPERATOR" "ACTIONS"`. SecRule directives
+// whose syntax, targets or id it cannot translate are skipped with a debug
+// log rather than failing the whole ruleset, since a partially-migrated
+// SecLang file is still more useful than none at all. Other directives are
+// ignored without a log, and operators other than @streq are lowered to a
+// regex match on their operand.
+type modSecurityRuleFormat struct{}
+
+func (modSecurityRuleFormat) Name() string { return "modsecurity" }
+
+func (f modSecurityRuleFormat) Compile(src []byte) ([]byte, error) {
+	var compiled []map[string]interface{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || !strings.HasPrefix(line, "SecRule") {
+			continue
+		}
+		rule, err := f.compileSecRule(line)
+		if err != nil {
+			log.Debug("appsec: modsecurity: skipping unsupported directive (%v): %s", err, line)
+			continue
+		}
+		compiled = append(compiled, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("appsec: modsecurity: could not read rules: %w", err)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"version": "2.2",
+		"rules":   compiled,
+	})
+}
+
+var secRuleRegexp = regexp.MustCompile(`^SecRule\s+(\S+)\s+"([^"]*)"\s+"([^"]*)"\s*$`)
+
+func (f modSecurityRuleFormat) compileSecRule(line string) (map[string]interface{}, error) {
+	m := secRuleRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("unsupported SecRule syntax")
+	}
+	targets := strings.Split(m[1], "|")
+	operator, value := splitSecRuleOperator(m[2])
+	id, name, blocking := parseSecRuleActions(m[3])
+	if id == "" {
+		return nil, fmt.Errorf("SecRule is missing an id action")
+	}
+
+	// ModSecurity ORs a SecRule's targets together (it fires if any one of
+	// them matches), which is exactly what the WAF does for the multiple
+	// inputs of a single condition. So every target becomes an input of the
+	// same condition rather than a condition of its own, which would AND
+	// them together and invert the rule's semantics.
+	inputs := make([]map[string]interface{}, 0, len(targets))
+	for _, target := range targets {
+		address, err := secRuleTargetToWAFAddress(target)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, map[string]interface{}{"address": address})
+	}
+
+	rule := map[string]interface{}{
+		"id":   id,
+		"name": name,
+		"tags": map[string]interface{}{"type": "modsecurity", "category": "attack_attempt"},
+		"conditions": []map[string]interface{}{
+			{
+				"operator": operator,
+				"parameters": map[string]interface{}{
+					"inputs": inputs,
+					wafOperatorParamKey(operator): value,
+				},
+			},
+		},
+	}
+	// A ModSecurity rule only blocks traffic when it carries a disruptive
+	// action (deny/block/drop); passive rules (pass, or log-only with no
+	// disruptive action) are monitoring-only and must not gain blocking
+	// behavior they never had, eg. most of OWASP CRS's anomaly-scoring rules.
+	if blocking {
+		rule["on_match"] = []string{"block"}
+	}
+	return rule, nil
+}
+
+// wafOperatorParamKey returns the parameters key the WAF expects the
+// operand of operator under, eg. "regex" for match_regex.
+func wafOperatorParamKey(operator string) string {
+	switch operator {
+	case "exact_match":
+		return "value"
+	default: // match_regex and anything else we don't special-case yet
+		return "regex"
+	}
+}
+
+// splitSecRuleOperator splits a ModSecurity operator expression such as
+// `@rx attack|pattern` into its operator and operand. Expressions without an
+// explicit `@operator` default to a regex match, matching ModSecurity's own
+// default.
+func splitSecRuleOperator(raw string) (operator, value string) {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, "@") {
+		return "match_regex", raw
+	}
+	parts := strings.SplitN(raw, " ", 2)
+	value = ""
+	if len(parts) > 1 {
+		value = parts[1]
+	}
+	switch parts[0] {
+	case "@streq":
+		return "exact_match", value
+	default: // @rx and anything else we don't special-case yet
+		return "match_regex", value
+	}
+}
+
+// parseSecRuleActions extracts the `id` and `msg` actions from a SecRule's
+// comma-separated action list, along with whether the rule carries a
+// disruptive action. ModSecurity's disruptive actions (deny, block, drop)
+// make a rule block the request it matches; everything else, including the
+// common `pass` and log-only rules CRS ships for passive monitoring, must
+// not block.
+func parseSecRuleActions(raw string) (id, msg string, blocking bool) {
+	for _, action := range strings.Split(raw, ",") {
+		action = strings.TrimSpace(action)
+		switch {
+		case strings.HasPrefix(action, "id:"):
+			id = strings.TrimPrefix(action, "id:")
+		case strings.HasPrefix(action, "msg:"):
+			msg = strings.Trim(strings.TrimPrefix(action, "msg:"), "'")
+		case action == "deny" || action == "block" || action == "drop":
+			blocking = true
+		case action == "pass" || action == "allow":
+			blocking = false
+		}
+	}
+	return id, msg, blocking
+}
+
+// secRuleTargetAddresses maps the ModSecurity variables we understand to the
+// WAF addresses they read from.
+var secRuleTargetAddresses = map[string]string{
+	"ARGS":            "server.request.query",
+	"ARGS_GET":        "server.request.query",
+	"ARGS_POST":       "server.request.body",
+	"REQUEST_HEADERS": "server.request.headers.no_cookies",
+	"REQUEST_COOKIES": "server.request.cookies",
+	"REQUEST_URI":     "server.request.uri.raw",
+	"REQUEST_BODY":    "server.request.body",
+}
+
+func secRuleTargetToWAFAddress(target string) (string, error) {
+	target = strings.SplitN(target, ":", 2)[0]
+	if addr, ok := secRuleTargetAddresses[strings.ToUpper(target)]; ok {
+		return addr, nil
+	}
+	return "", fmt.Errorf("unsupported SecRule target %q", target)
+}
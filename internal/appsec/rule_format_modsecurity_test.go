@@ -0,0 +1,123 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package appsec
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModSecurityRuleFormatCompile(t *testing.T) {
+	f := modSecurityRuleFormat{}
+
+	t.Run("multiple targets are ORed within a single condition", func(t *testing.T) {
+		// A real OWASP CRS-style rule: ModSecurity fires this if ARGS OR
+		// REQUEST_HEADERS matches, which must translate to both addresses
+		// living in one condition's inputs, not two AND'd conditions.
+		src := []byte(`SecRule ARGS|REQUEST_HEADERS "@rx (?i:union\s+select)" "id:942100,phase:2,deny,msg:'SQL Injection Attack'"`)
+		out, err := f.Compile(src)
+		require.NoError(t, err)
+
+		var doc struct {
+			Rules []struct {
+				ID         string   `json:"id"`
+				OnMatch    []string `json:"on_match"`
+				Conditions []struct {
+					Operator   string `json:"operator"`
+					Parameters struct {
+						Inputs []struct {
+							Address string `json:"address"`
+						} `json:"inputs"`
+						Regex string `json:"regex"`
+					} `json:"parameters"`
+				} `json:"conditions"`
+			} `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(out, &doc))
+		require.Len(t, doc.Rules, 1)
+
+		rule := doc.Rules[0]
+		assert.Equal(t, "942100", rule.ID)
+		assert.Equal(t, []string{"block"}, rule.OnMatch)
+		require.Len(t, rule.Conditions, 1)
+
+		cond := rule.Conditions[0]
+		assert.Equal(t, "match_regex", cond.Operator)
+		assert.Equal(t, `(?i:union\s+select)`, cond.Parameters.Regex)
+		require.Len(t, cond.Parameters.Inputs, 2)
+		assert.Equal(t, "server.request.query", cond.Parameters.Inputs[0].Address)
+		assert.Equal(t, "server.request.headers.no_cookies", cond.Parameters.Inputs[1].Address)
+	})
+
+	t.Run("pass/log-only rules do not become blocking", func(t *testing.T) {
+		// CRS ships plenty of passive, scoring-only rules like this one;
+		// importing them must not turn them into blocking WAF rules.
+		src := []byte(`SecRule ARGS "@rx (?i:union\s+select)" "id:942100,phase:2,log,pass,msg:'SQL Injection Attack'"`)
+		out, err := f.Compile(src)
+		require.NoError(t, err)
+
+		var doc struct {
+			Rules []struct {
+				ID      string   `json:"id"`
+				OnMatch []string `json:"on_match"`
+			} `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(out, &doc))
+		require.Len(t, doc.Rules, 1)
+		assert.Empty(t, doc.Rules[0].OnMatch)
+	})
+
+	t.Run("an unsupported target is rejected rather than silently remapped", func(t *testing.T) {
+		src := []byte(`SecRule REQUEST_FILENAME "@rx /etc/passwd" "id:1,deny"`)
+		out, err := f.Compile(src)
+		require.NoError(t, err)
+
+		var doc struct {
+			Rules []interface{} `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(out, &doc))
+		assert.Empty(t, doc.Rules, "an unsupported target must cause the rule to be skipped, not compiled against the wrong address")
+	})
+
+	t.Run("@streq uses the value parameter key", func(t *testing.T) {
+		src := []byte(`SecRule REQUEST_URI "@streq /admin" "id:1,deny"`)
+		out, err := f.Compile(src)
+		require.NoError(t, err)
+
+		var doc struct {
+			Rules []struct {
+				OnMatch    []string `json:"on_match"`
+				Conditions []struct {
+					Operator   string                 `json:"operator"`
+					Parameters map[string]interface{} `json:"parameters"`
+				} `json:"conditions"`
+			} `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(out, &doc))
+		require.Len(t, doc.Rules, 1)
+		assert.Equal(t, []string{"block"}, doc.Rules[0].OnMatch)
+
+		cond := doc.Rules[0].Conditions[0]
+		assert.Equal(t, "exact_match", cond.Operator)
+		assert.Equal(t, "/admin", cond.Parameters["value"])
+		assert.NotContains(t, cond.Parameters, "regex")
+	})
+
+	t.Run("rules without an id action are skipped", func(t *testing.T) {
+		src := []byte(`SecRule ARGS "@rx attack" "phase:2,deny"`)
+		out, err := f.Compile(src)
+		require.NoError(t, err)
+
+		var doc struct {
+			Rules []interface{} `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(out, &doc))
+		assert.Empty(t, doc.Rules)
+	})
+}
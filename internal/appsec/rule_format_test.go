@@ -0,0 +1,20 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package appsec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectRuleFormat(t *testing.T) {
+	assert.Equal(t, "modsecurity", detectRuleFormat("rules.conf", nil).Name())
+	assert.Equal(t, "modsecurity", detectRuleFormat("rules.seclang", nil).Name())
+	assert.Equal(t, "modsecurity", detectRuleFormat("rules.txt", []byte(`SecRule ARGS "@rx x" "id:1"`)).Name())
+	assert.Nil(t, detectRuleFormat("rules.json", []byte(`{"rules":[]}`)))
+	assert.Nil(t, detectRuleFormat("rules.json", nil))
+}
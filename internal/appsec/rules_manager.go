@@ -0,0 +1,52 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package appsec
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// rulesManager holds the resolved WAF rule set that AppSec was started or
+// last reloaded with. It is safe for concurrent use, so that a hot-reload
+// (eg. from WithLocalRuleWatch or remote configuration) can swap the rules
+// while they're being read to start or restart the WAF.
+type rulesManager struct {
+	mu  sync.RWMutex
+	raw []byte
+}
+
+// newRulesManager validates raw as a WAF rule payload and wraps it into a
+// rulesManager.
+func newRulesManager(raw []byte) (*rulesManager, error) {
+	if !json.Valid(raw) {
+		return nil, fmt.Errorf("appsec: the given rules are not valid JSON")
+	}
+	return &rulesManager{raw: raw}, nil
+}
+
+// Raw returns the resolved WAF rule payload currently in use. It is mainly
+// useful for introspection, eg. to confirm which rules ended up being loaded
+// once all of the configured rule sources have been merged.
+func (r *rulesManager) Raw() []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.raw
+}
+
+// update validates raw as a WAF rule payload and, if valid, atomically swaps
+// it in as the rule set returned by Raw. The previous rule set is left
+// untouched when raw is invalid.
+func (r *rulesManager) update(raw []byte) error {
+	if !json.Valid(raw) {
+		return fmt.Errorf("appsec: the given rules are not valid JSON")
+	}
+	r.mu.Lock()
+	r.raw = raw
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,244 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package appsec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+
+	rules "github.com/DataDog/appsec-internal-go/appsec"
+)
+
+// defaultRulesURLTimeout bounds how long WithRulesFromURL waits for the
+// rules file to download, so that an unreachable or slow URL can't hang
+// appsec.Start() indefinitely.
+const defaultRulesURLTimeout = 10 * time.Second
+
+// rulesURLHTTPClient is the client used by WithRulesFromURL.
+var rulesURLHTTPClient = &http.Client{Timeout: defaultRulesURLTimeout}
+
+// ruleSource is a single origin of WAF rules that gets merged into the final
+// rule set used to start AppSec.
+type ruleSource struct {
+	// name identifies the source in logs and error messages, eg. a file path
+	// or URL.
+	name string
+	// fetch returns the raw rules payload produced by this source.
+	fetch func() ([]byte, error)
+}
+
+// WithRules registers a set of WAF rules held in memory to be merged into the
+// rule set used to start AppSec, in addition to the rules resolved from
+// DD_APPSEC_RULES and the builtin recommended rules.
+func WithRules(rawRules []byte) StartOption {
+	return func(c *Config) {
+		c.ruleSources = append(c.ruleSources, ruleSource{
+			name:  "in-memory rules",
+			fetch: func() ([]byte, error) { return compileIfNeeded("in-memory rules", rawRules) },
+		})
+	}
+}
+
+// WithRuleSource registers a set of WAF rules read from r to be merged into
+// the rule set used to start AppSec. r is read once, when AppSec starts.
+func WithRuleSource(r io.Reader) StartOption {
+	return func(c *Config) {
+		var (
+			once sync.Once
+			buf  []byte
+			err  error
+		)
+		c.ruleSources = append(c.ruleSources, ruleSource{
+			name: "rule reader",
+			fetch: func() ([]byte, error) {
+				once.Do(func() { buf, err = io.ReadAll(r) })
+				if err != nil {
+					return nil, err
+				}
+				return compileIfNeeded("rule reader", buf)
+			},
+		})
+	}
+}
+
+// WithRulesFromFile registers a local rules file to be merged into the rule
+// set used to start AppSec. It may be called more than once to merge rules
+// from several files.
+func WithRulesFromFile(path string) StartOption {
+	return func(c *Config) {
+		c.ruleSources = append(c.ruleSources, ruleSource{
+			name: path,
+			fetch: func() ([]byte, error) {
+				buf, err := os.ReadFile(path)
+				if err != nil {
+					return nil, err
+				}
+				return compileIfNeeded(path, buf)
+			},
+		})
+	}
+}
+
+// WithRulesFromURL registers a rules file fetched over HTTP(S) to be merged
+// into the rule set used to start AppSec. When sha256Checksum is non-empty,
+// the downloaded payload is rejected if its SHA-256 checksum does not match.
+func WithRulesFromURL(url string, sha256Checksum string) StartOption {
+	return func(c *Config) {
+		c.ruleSources = append(c.ruleSources, ruleSource{
+			name: url,
+			fetch: func() ([]byte, error) {
+				resp, err := rulesURLHTTPClient.Get(url)
+				if err != nil {
+					return nil, fmt.Errorf("appsec: could not download rules from %s: %w", url, err)
+				}
+				defer resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					return nil, fmt.Errorf("appsec: could not download rules from %s: unexpected status code %d", url, resp.StatusCode)
+				}
+				buf, err := io.ReadAll(resp.Body)
+				if err != nil {
+					return nil, fmt.Errorf("appsec: could not download rules from %s: %w", url, err)
+				}
+				if sha256Checksum != "" {
+					sum := sha256.Sum256(buf)
+					if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, sha256Checksum) {
+						return nil, fmt.Errorf("appsec: checksum mismatch for rules downloaded from %s: expected %s, got %s", url, sha256Checksum, got)
+					}
+				}
+				return compileIfNeeded(url, buf)
+			},
+		})
+	}
+}
+
+// readRulesConfig resolves the rules payload AppSec should start with,
+// merging every configured source with the following precedence, from
+// lowest to highest: the builtin recommended rules, the programmatic
+// sources registered through WithRules/WithRuleSource/WithRulesFromFile/
+// WithRulesFromURL in registration order, and finally DD_APPSEC_RULES.
+// When no programmatic source is configured, DD_APPSEC_RULES keeps its
+// pre-existing behavior of replacing the builtin rules outright rather than
+// being merged with them, so a minimal custom ruleset crafted to drop
+// categories of builtin rules doesn't get them silently reintroduced. When
+// neither a programmatic source nor the env var is configured, the builtin
+// rules are returned unchanged.
+func readRulesConfig(sources []ruleSource) ([]byte, error) {
+	return buildRulesPayload(sources, os.Getenv(rulesEnvVar))
+}
+
+// buildRulesPayload is the shared implementation behind readRulesConfig and
+// the local rule file watcher's reload path. See readRulesConfig for the
+// precedence and the DD_APPSEC_RULES-replaces-builtin backward-compatibility
+// rule; this is factored out so a hot-reload of the local rules file goes
+// through the exact same merge as startup does, instead of swapping in the
+// bare file contents and silently dropping every other source.
+func buildRulesPayload(sources []ruleSource, localRulesPath string) ([]byte, error) {
+	if localRulesPath != "" && len(sources) == 0 {
+		return readLocalRulesFile(localRulesPath)
+	}
+
+	payloads := [][]byte{[]byte(rules.StaticRecommendedRules)}
+
+	for _, src := range sources {
+		buf, err := src.fetch()
+		if err != nil {
+			return nil, fmt.Errorf("appsec: could not load rules from %s: %w", src.name, err)
+		}
+		payloads = append(payloads, buf)
+	}
+
+	if localRulesPath != "" {
+		buf, err := readLocalRulesFile(localRulesPath)
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, buf)
+	} else {
+		log.Debug("appsec: using the default built-in recommended security rules")
+	}
+
+	if len(payloads) == 1 {
+		return payloads[0], nil
+	}
+	return mergeRules(payloads...)
+}
+
+// readLocalRulesFile reads and compiles the rules file referenced by
+// DD_APPSEC_RULES/WithLocalRuleWatch.
+func readLocalRulesFile(path string) ([]byte, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Error("appsec: could not find the rules file in path %s: %v.", path, err)
+		}
+		return nil, err
+	}
+	buf, err = compileIfNeeded(path, buf)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("appsec: using the security rules from file %s", path)
+	return buf, nil
+}
+
+// mergeRules merges the given rule payloads into a single WAF rule set.
+// Payloads are applied in order: a rule with the same "id" coming from a
+// later payload replaces the one from an earlier payload, and so do any
+// top-level keys other than "rules". This gives later payloads precedence
+// while keeping the merge deterministic regardless of map iteration order.
+func mergeRules(payloads ...[]byte) ([]byte, error) {
+	merged := map[string]interface{}{}
+	rulesByID := map[string]interface{}{}
+	var order []string
+
+	for _, payload := range payloads {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(payload, &doc); err != nil {
+			return nil, fmt.Errorf("appsec: could not parse rules payload: %w", err)
+		}
+		if rawRules, ok := doc["rules"].([]interface{}); ok {
+			for _, rule := range rawRules {
+				ruleMap, ok := rule.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				id, _ := ruleMap["id"].(string)
+				if id == "" {
+					id = fmt.Sprintf("__unkeyed_%d", len(order))
+				}
+				if _, exists := rulesByID[id]; !exists {
+					order = append(order, id)
+				}
+				rulesByID[id] = ruleMap
+			}
+		}
+		delete(doc, "rules")
+		for k, v := range doc {
+			merged[k] = v
+		}
+	}
+
+	merged["rules"] = rulesIDsToSlice(order, rulesByID)
+	return json.Marshal(merged)
+}
+
+func rulesIDsToSlice(order []string, rulesByID map[string]interface{}) []interface{} {
+	out := make([]interface{}, 0, len(order))
+	for _, id := range order {
+		out = append(out, rulesByID[id])
+	}
+	return out
+}
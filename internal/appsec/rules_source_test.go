@@ -0,0 +1,232 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package appsec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeRules(t *testing.T) {
+	t.Run("later payload overrides a rule with the same id", func(t *testing.T) {
+		base := []byte(`{"version":"1.0","rules":[{"id":"1","name":"base"}]}`)
+		override := []byte(`{"version":"2.0","rules":[{"id":"1","name":"override"},{"id":"2","name":"extra"}]}`)
+
+		out, err := mergeRules(base, override)
+		require.NoError(t, err)
+
+		var doc struct {
+			Version string                   `json:"version"`
+			Rules   []map[string]interface{} `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(out, &doc))
+
+		// The later payload wins both for the top-level "version" key and
+		// for the rule sharing id "1".
+		assert.Equal(t, "2.0", doc.Version)
+		require.Len(t, doc.Rules, 2)
+		assert.Equal(t, "override", doc.Rules[0]["name"])
+		assert.Equal(t, "extra", doc.Rules[1]["name"])
+	})
+
+	t.Run("invalid JSON is rejected", func(t *testing.T) {
+		_, err := mergeRules([]byte(`not json`))
+		assert.Error(t, err)
+	})
+}
+
+func TestReadRulesConfigPrecedence(t *testing.T) {
+	t.Run("programmatic source overrides the builtin rules", func(t *testing.T) {
+		programmatic := ruleSource{
+			name:  "memory",
+			fetch: func() ([]byte, error) { return []byte(`{"rules":[{"id":"ua0-600-56x","name":"overridden"}]}`), nil },
+		}
+
+		out, err := readRulesConfig([]ruleSource{programmatic})
+		require.NoError(t, err)
+
+		var doc struct {
+			Rules []map[string]interface{} `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(out, &doc))
+
+		found := false
+		for _, r := range doc.Rules {
+			if r["id"] == "ua0-600-56x" {
+				found = true
+				assert.Equal(t, "overridden", r["name"])
+			}
+		}
+		assert.True(t, found, "expected the programmatic rule to be present in the merged rule set")
+	})
+
+	t.Run("the env var file overrides programmatic sources", func(t *testing.T) {
+		path := writeTempRulesFile(t, `{"rules":[{"id":"custom","name":"from-env"}]}`)
+		t.Setenv(rulesEnvVar, path)
+
+		programmatic := ruleSource{
+			name:  "memory",
+			fetch: func() ([]byte, error) { return []byte(`{"rules":[{"id":"custom","name":"from-memory"}]}`), nil },
+		}
+
+		out, err := readRulesConfig([]ruleSource{programmatic})
+		require.NoError(t, err)
+
+		var doc struct {
+			Rules []map[string]interface{} `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(out, &doc))
+
+		// The builtin rules and the programmatic source are still merged in
+		// alongside DD_APPSEC_RULES when other sources are configured; only
+		// the env var's own precedence over the programmatic source (not
+		// the total rule count) is asserted here.
+		found := false
+		for _, r := range doc.Rules {
+			if r["id"] == "custom" {
+				found = true
+				assert.Equal(t, "from-env", r["name"])
+			}
+		}
+		assert.True(t, found, "expected the custom rule to be present in the merged rule set")
+	})
+
+	t.Run("DD_APPSEC_RULES alone replaces the builtin rules rather than merging with them", func(t *testing.T) {
+		// Preserves the pre-existing behavior of the env var: an operator
+		// who points DD_APPSEC_RULES at a minimal custom ruleset to
+		// deliberately drop categories of builtin rules must not get them
+		// silently reintroduced by the merge.
+		path := writeTempRulesFile(t, `{"rules":[{"id":"custom","name":"from-env"}]}`)
+		t.Setenv(rulesEnvVar, path)
+
+		out, err := readRulesConfig(nil)
+		require.NoError(t, err)
+
+		var doc struct {
+			Rules []map[string]interface{} `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(out, &doc))
+		require.Len(t, doc.Rules, 1)
+		assert.Equal(t, "custom", doc.Rules[0]["id"])
+		assert.Equal(t, "from-env", doc.Rules[0]["name"])
+	})
+
+	t.Run("no sources and no env var returns the builtin rules unchanged", func(t *testing.T) {
+		out, err := readRulesConfig(nil)
+		require.NoError(t, err)
+		assert.True(t, json.Valid(out))
+	})
+}
+
+func TestWithRulesFromURL(t *testing.T) {
+	t.Run("checksum mismatch is rejected", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"rules":[]}`))
+		}))
+		defer srv.Close()
+
+		wrongSum := hex.EncodeToString(make([]byte, sha256.Size))
+		var c Config
+		WithRulesFromURL(srv.URL, wrongSum)(&c)
+		require.Len(t, c.ruleSources, 1)
+
+		_, err := c.ruleSources[0].fetch()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "checksum mismatch")
+	})
+
+	t.Run("matching checksum is accepted", func(t *testing.T) {
+		const body = `{"rules":[]}`
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		defer srv.Close()
+
+		rawSum := sha256.Sum256([]byte(body))
+		sum := hex.EncodeToString(rawSum[:])
+		var c Config
+		WithRulesFromURL(srv.URL, sum)(&c)
+		require.Len(t, c.ruleSources, 1)
+
+		buf, err := c.ruleSources[0].fetch()
+		require.NoError(t, err)
+		assert.JSONEq(t, body, string(buf))
+	})
+
+	t.Run("matching checksum in a different case is accepted", func(t *testing.T) {
+		// Tooling commonly prints SHA-256 digests in uppercase; a caller
+		// pasting one of those shouldn't get a spurious mismatch.
+		const body = `{"rules":[]}`
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		defer srv.Close()
+
+		rawSum := sha256.Sum256([]byte(body))
+		sum := strings.ToUpper(hex.EncodeToString(rawSum[:]))
+		var c Config
+		WithRulesFromURL(srv.URL, sum)(&c)
+		require.Len(t, c.ruleSources, 1)
+
+		buf, err := c.ruleSources[0].fetch()
+		require.NoError(t, err)
+		assert.JSONEq(t, body, string(buf))
+	})
+}
+
+func TestWithRulesCompilesNonNativeFormats(t *testing.T) {
+	t.Run("WithRules compiles a SecRule payload", func(t *testing.T) {
+		src := []byte(`SecRule ARGS "@rx attack" "id:1,deny"`)
+		var c Config
+		WithRules(src)(&c)
+		require.Len(t, c.ruleSources, 1)
+
+		buf, err := c.ruleSources[0].fetch()
+		require.NoError(t, err)
+		assert.True(t, json.Valid(buf))
+
+		var doc struct {
+			Rules []map[string]interface{} `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(buf, &doc))
+		require.Len(t, doc.Rules, 1)
+		assert.Equal(t, "1", doc.Rules[0]["id"])
+	})
+
+	t.Run("WithRuleSource compiles a SecRule payload", func(t *testing.T) {
+		src := strings.NewReader(`SecRule ARGS "@rx attack" "id:1,deny"`)
+		var c Config
+		WithRuleSource(src)(&c)
+		require.Len(t, c.ruleSources, 1)
+
+		buf, err := c.ruleSources[0].fetch()
+		require.NoError(t, err)
+		assert.True(t, json.Valid(buf))
+
+		var doc struct {
+			Rules []map[string]interface{} `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(buf, &doc))
+		require.Len(t, doc.Rules, 1)
+		assert.Equal(t, "1", doc.Rules[0]["id"])
+	})
+}
+
+func writeTempRulesFile(t *testing.T, content string) string {
+	t.Helper()
+	path := t.TempDir() + "/rules.json"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
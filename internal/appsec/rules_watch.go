@@ -0,0 +1,131 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package appsec
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WithLocalRuleWatch enables hot-reloading of the local rules file referenced
+// by DD_APPSEC_RULES: changes to the file are detected through filesystem
+// notifications or, where those are unavailable, by polling the file's
+// modification time every interval, and the running rule set is swapped in
+// place, without requiring a restart. It has no effect when DD_APPSEC_RULES is not set. A reload that
+// fails, eg. because the file was left in an invalid state mid-write, is
+// logged and the previous rule set stays active.
+func WithLocalRuleWatch(interval time.Duration) StartOption {
+	return func(c *Config) {
+		c.localRuleWatchInterval = interval
+	}
+}
+
+// startLocalRuleWatch watches path for changes and, on change, rebuilds the
+// full rule set from sources the same way newConfig did at startup and swaps
+// it into rm. It prefers fsnotify and falls back to polling at interval when
+// a watcher can't be set up, eg. because the filesystem doesn't support it.
+// The returned stop func terminates the watch goroutine and must be called
+// when AppSec stops, or it leaks for the lifetime of the process.
+func startLocalRuleWatch(rm *rulesManager, path string, sources []ruleSource, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+	stop = func() { once.Do(func() { close(done) }) }
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Debug("appsec: could not create a filesystem watcher, falling back to polling %s every %s: %v", path, interval, err)
+		go pollLocalRuleFile(rm, path, sources, interval, done)
+		return stop
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		log.Debug("appsec: could not watch %s, falling back to polling every %s: %v", path, interval, err)
+		watcher.Close()
+		go pollLocalRuleFile(rm, path, sources, interval, done)
+		return stop
+	}
+
+	go watchLocalRuleFile(rm, path, sources, watcher, done)
+	closeDone := stop
+	return func() {
+		closeDone()
+		watcher.Close()
+	}
+}
+
+func watchLocalRuleFile(rm *rulesManager, path string, sources []ruleSource, watcher *fsnotify.Watcher, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != filepath.Clean(path) {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			reloadLocalRuleFile(rm, path, sources)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Error("appsec: error watching the rules file %s: %v", path, err)
+		}
+	}
+}
+
+func pollLocalRuleFile(rm *rulesManager, path string, sources []ruleSource, interval time.Duration, done <-chan struct{}) {
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				log.Debug("appsec: could not stat the rules file %s: %v", path, err)
+				continue
+			}
+			if !info.ModTime().After(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+			reloadLocalRuleFile(rm, path, sources)
+		}
+	}
+}
+
+// reloadLocalRuleFile rebuilds the full rule set - builtin recommended
+// rules, every programmatic ruleSource and the local rules file at path -
+// through the same precedence as newConfig, so a hot-reload never drops the
+// other configured sources.
+func reloadLocalRuleFile(rm *rulesManager, path string, sources []ruleSource) {
+	buf, err := buildRulesPayload(sources, path)
+	if err != nil {
+		log.Error("appsec: could not reload the rules file %s, keeping the previous rule set active: %v", path, err)
+		return
+	}
+	if err := rm.update(buf); err != nil {
+		log.Error("appsec: the reloaded rules file %s is invalid, keeping the previous rule set active: %v", path, err)
+		return
+	}
+	log.Debug("appsec: successfully reloaded the rules file %s", path)
+}
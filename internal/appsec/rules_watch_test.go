@@ -0,0 +1,113 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package appsec
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ruleNamed asserts raw decodes to a rule set containing a rule with the
+// given id and returns its "name" field, so tests can assert on a reload's
+// effect without depending on the exact shape of the builtin rules that get
+// merged in alongside it.
+func ruleNamed(t *testing.T, raw []byte, id string) (name string, ok bool) {
+	t.Helper()
+	var doc struct {
+		Rules []map[string]interface{} `json:"rules"`
+	}
+	require.NoError(t, json.Unmarshal(raw, &doc))
+	for _, r := range doc.Rules {
+		if r["id"] == id {
+			name, _ = r["name"].(string)
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func TestPollLocalRuleFile(t *testing.T) {
+	path := writeTempRulesFile(t, `{"rules":[{"id":"custom","name":"initial"}]}`)
+	rm, err := newRulesManager([]byte(`{"rules":[{"id":"custom","name":"initial"}]}`))
+	require.NoError(t, err)
+
+	const interval = 10 * time.Millisecond
+	done := make(chan struct{})
+	go pollLocalRuleFile(rm, path, nil, interval, done)
+	defer close(done)
+
+	// The mtime resolution on some filesystems is coarse enough that writing
+	// again immediately can land on the same timestamp pollLocalRuleFile
+	// already saw, so back off a little before the update.
+	time.Sleep(2 * interval)
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"id":"custom","name":"reloaded"}]}`), 0o600))
+
+	require.Eventually(t, func() bool {
+		name, ok := ruleNamed(t, rm.Raw(), "custom")
+		return ok && name == "reloaded"
+	}, time.Second, interval, "the reloaded rules were never picked up")
+}
+
+func TestStartLocalRuleWatchStop(t *testing.T) {
+	path := writeTempRulesFile(t, `{"rules":[{"id":"custom","name":"initial"}]}`)
+	rm, err := newRulesManager([]byte(`{"rules":[{"id":"custom","name":"initial"}]}`))
+	require.NoError(t, err)
+
+	const interval = 10 * time.Millisecond
+	stop := startLocalRuleWatch(rm, path, nil, interval)
+
+	time.Sleep(2 * interval)
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"id":"custom","name":"reloaded"}]}`), 0o600))
+	require.Eventually(t, func() bool {
+		name, ok := ruleNamed(t, rm.Raw(), "custom")
+		return ok && name == "reloaded"
+	}, time.Second, interval, "the reloaded rules were never picked up")
+
+	// Stopping must terminate the watch goroutine: further changes to the
+	// file are no longer picked up.
+	stop()
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"id":"custom","name":"ignored"}]}`), 0o600))
+	time.Sleep(5 * interval)
+	name, ok := ruleNamed(t, rm.Raw(), "custom")
+	require.True(t, ok)
+	assert.Equal(t, "reloaded", name)
+
+	// stop must be idempotent.
+	assert.NotPanics(t, func() { stop() })
+}
+
+func TestReloadLocalRuleFilePreservesOtherSources(t *testing.T) {
+	// A reload must re-run the same builtin+sources+file merge newConfig did
+	// at startup, not just swap in the bare file contents: otherwise the
+	// very first edit to the watched file would silently drop every
+	// programmatic rule source along with the builtin recommended rules.
+	path := writeTempRulesFile(t, `{"rules":[{"id":"from-file","name":"initial"}]}`)
+	sources := []ruleSource{{
+		name:  "memory",
+		fetch: func() ([]byte, error) { return []byte(`{"rules":[{"id":"from-memory","name":"programmatic"}]}`), nil },
+	}}
+
+	initial, err := buildRulesPayload(sources, path)
+	require.NoError(t, err)
+	rm, err := newRulesManager(initial)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"id":"from-file","name":"reloaded"}]}`), 0o600))
+	reloadLocalRuleFile(rm, path, sources)
+
+	fileRuleName, ok := ruleNamed(t, rm.Raw(), "from-file")
+	require.True(t, ok)
+	assert.Equal(t, "reloaded", fileRuleName)
+
+	memoryRuleName, ok := ruleNamed(t, rm.Raw(), "from-memory")
+	require.True(t, ok, "the programmatic rule source must survive a local rule file reload")
+	assert.Equal(t, "programmatic", memoryRuleName)
+}